@@ -0,0 +1,291 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// RegistrationMode distinguishes how a Registry publishes its service metadata.
+type RegistrationMode int
+
+const (
+	// RegistrationModeInterface is the traditional per-service (interface-level) mode where
+	// a registry publishes full service and instance metadata directly through
+	// model.ServiceDiscovery. This is the default and preserves existing behavior.
+	RegistrationModeInterface RegistrationMode = iota
+
+	// RegistrationModeApplication is an application-level mode where a registry publishes a
+	// single Application record per workload (name, revision, instances) and relies on a
+	// MetadataServiceClient to resolve the services and ports that application implements.
+	// Services()/GetService()/Instances()/InstancesByPort() all join against this resolved
+	// metadata; ManagementPorts/GetProxyServiceInstances/GetIstioServiceAccounts aren't
+	// supported, since application-level registries don't report that per-address data. This
+	// scales better than interface-level registration for applications that expose many
+	// services, since identical revisions only need to be resolved once.
+	RegistrationModeApplication
+)
+
+// AppInstance is a single workload instance reported by an application-level registry.
+type AppInstance struct {
+	App      string
+	Revision string
+	Address  string
+	Labels   model.Labels
+}
+
+// Application is the record published by a registry running in RegistrationModeApplication.
+// It carries no service metadata directly; callers must resolve the Revision through a
+// MetadataServiceClient to discover which services and ports the Instances implement.
+type Application struct {
+	Name      string
+	Revision  string
+	Instances []*AppInstance
+}
+
+// MetadataService enumerates the services and ports implemented by the instances of an
+// Application sharing a given Revision.
+type MetadataService struct {
+	Revision string
+	Services []*model.Service
+}
+
+// MetadataServiceClient is implemented by application-level registry adapters to resolve a
+// revision into the service and port metadata its instances implement.
+type MetadataServiceClient interface {
+	GetMetadataService(revision string) (*MetadataService, error)
+}
+
+// ApplicationRegistry is implemented by registries running in RegistrationModeApplication to
+// report their current Application record.
+type ApplicationRegistry interface {
+	GetApplication() (*Application, error)
+}
+
+// errApplicationModeUnsupported reports that method was called against a registry running in
+// RegistrationModeApplication, for a Controller method that has no equivalent in the
+// Application/MetadataService model, unlike Services/GetService/Instances/InstancesByPort
+// which join against the resolved metadata. Only GetProxyServiceInstances returns it;
+// ManagementPorts and GetIstioServiceAccounts return no error and skip such registries.
+func errApplicationModeUnsupported(r Registry, method string) error {
+	return fmt.Errorf("registry %s is in application registration mode; %s is not supported for it", r.ClusterID, method)
+}
+
+// resolveApplication fetches r's current Application record and the MetadataService for its
+// revision together: building either the joined service list or the joined instances needs
+// both the workload addresses from Application.Instances and the service/port metadata from
+// MetadataService.
+func (c *Controller) resolveApplication(r Registry) (*Application, *MetadataService, error) {
+	if r.App == nil {
+		return nil, nil, fmt.Errorf("registry %s is in application registration mode but has no ApplicationRegistry configured", r.ClusterID)
+	}
+
+	app, err := r.App.GetApplication()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, err := c.resolveMetadata(r, app.Revision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.appMu.Lock()
+	for _, svc := range meta.Services {
+		c.hostnameApp[svc.Hostname] = appRevisionKey(app.Name, app.Revision)
+	}
+	c.appMu.Unlock()
+
+	return app, meta, nil
+}
+
+// joinApplication resolves an application-level registry into a flat list of services by
+// fetching its Application record and joining it against the cached MetadataService for that
+// application's revision.
+func (c *Controller) joinApplication(r Registry) ([]*model.Service, error) {
+	_, meta, err := c.resolveApplication(r)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Services, nil
+}
+
+// getServiceFromApplication resolves hostname against an application-level registry's joined
+// view, for callers (GetService) that only need a single hostname rather than the full list.
+func (c *Controller) getServiceFromApplication(r Registry, hostname model.Hostname) (*model.Service, error) {
+	svcs, err := c.joinApplication(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range svcs {
+		if s.Hostname == hostname {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+// instancesFromApplication resolves instances of hostname from an application-level registry,
+// by joining the addresses in its Application.Instances against the ports the resolved
+// MetadataService publishes for hostname. portNames restricts the result to ports with a
+// matching name; an empty portNames matches every port.
+func (c *Controller) instancesFromApplication(r Registry, hostname model.Hostname, portNames []string) ([]*model.ServiceInstance, error) {
+	app, meta, err := c.resolveApplication(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var svc *model.Service
+	for _, s := range meta.Services {
+		if s.Hostname == hostname {
+			svc = s
+			break
+		}
+	}
+	if svc == nil {
+		return nil, nil
+	}
+
+	return joinInstances(app, svc, func(p *model.Port) bool {
+		return len(portNames) == 0 || containsString(portNames, p.Name)
+	}), nil
+}
+
+// instancesByPortFromApplication is instancesFromApplication restricted to a single port
+// number instead of a set of port names.
+func (c *Controller) instancesByPortFromApplication(r Registry, hostname model.Hostname, port int) ([]*model.ServiceInstance, error) {
+	app, meta, err := c.resolveApplication(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var svc *model.Service
+	for _, s := range meta.Services {
+		if s.Hostname == hostname {
+			svc = s
+			break
+		}
+	}
+	if svc == nil {
+		return nil, nil
+	}
+
+	return joinInstances(app, svc, func(p *model.Port) bool {
+		return p.Port == port
+	}), nil
+}
+
+// joinInstances builds one ServiceInstance per (AppInstance, matching port) pair, giving
+// xDS concrete endpoints for an application-level registry's services.
+func joinInstances(app *Application, svc *model.Service, matchPort func(*model.Port) bool) []*model.ServiceInstance {
+	var instances []*model.ServiceInstance
+	for _, inst := range app.Instances {
+		for _, p := range svc.Ports {
+			if !matchPort(p) {
+				continue
+			}
+			instances = append(instances, &model.ServiceInstance{
+				Service: svc,
+				Endpoint: model.NetworkEndpoint{
+					Address:     inst.Address,
+					Port:        p.Port,
+					ServicePort: p,
+				},
+				Labels: inst.Labels,
+			})
+		}
+	}
+	return instances
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveMetadata returns the MetadataService for revision, fetching it through r.Metadata
+// only if it isn't already cached. Instances that share a revision therefore only trigger a
+// single metadata fetch.
+func (c *Controller) resolveMetadata(r Registry, revision string) (*MetadataService, error) {
+	c.appMu.RLock()
+	if cached, ok := c.metadataCache[revision]; ok {
+		c.appMu.RUnlock()
+		return cached, nil
+	}
+	c.appMu.RUnlock()
+
+	if r.Metadata == nil {
+		return nil, fmt.Errorf("registry %s is in application registration mode but has no MetadataServiceClient configured", r.ClusterID)
+	}
+
+	meta, err := r.Metadata.GetMetadataService(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	c.appMu.Lock()
+	c.metadataCache[revision] = meta
+	c.appMu.Unlock()
+	return meta, nil
+}
+
+// invalidateMetadata drops the cached join for whichever application-revision currently
+// serves hostname, so the next Services()/InstancesByPort() call re-fetches it. It is called
+// whenever a handler installed through wrapServiceHandler fires; such handlers are only
+// attached to interface-level registries, so it acts only when one of them reports a hostname
+// that an application-level registry's join also serves.
+func (c *Controller) invalidateMetadata(hostname model.Hostname) {
+	c.appMu.Lock()
+	defer c.appMu.Unlock()
+
+	key, ok := c.hostnameApp[hostname]
+	if !ok {
+		return
+	}
+	if _, revision, ok := splitAppRevisionKey(key); ok {
+		delete(c.metadataCache, revision)
+	}
+	delete(c.hostnameApp, hostname)
+}
+
+// resetApplicationState drops every cached application-join entry (the hostname -> revision
+// index and the resolved MetadataService by revision), so a deleted registry's joined services
+// don't linger. The next Services()/GetService() call against an application-mode registry
+// re-resolves its revision from scratch.
+func (c *Controller) resetApplicationState() {
+	c.appMu.Lock()
+	defer c.appMu.Unlock()
+	c.hostnameApp = make(map[model.Hostname]string)
+	c.metadataCache = make(map[string]*MetadataService)
+}
+
+func appRevisionKey(app, revision string) string {
+	return app + "@" + revision
+}
+
+func splitAppRevisionKey(key string) (app, revision string, ok bool) {
+	parts := strings.SplitN(key, "@", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// fakeApplicationRegistry is a minimal ApplicationRegistry that counts how many times
+// GetApplication is called, so tests can assert on cache reuse.
+type fakeApplicationRegistry struct {
+	app   *Application
+	calls int
+}
+
+func (f *fakeApplicationRegistry) GetApplication() (*Application, error) {
+	f.calls++
+	return f.app, nil
+}
+
+// fakeMetadataServiceClient is a minimal MetadataServiceClient that counts how many times
+// GetMetadataService is called per revision, so tests can assert resolveMetadata only fetches
+// a revision once.
+type fakeMetadataServiceClient struct {
+	services map[string][]*model.Service
+	calls    map[string]int
+}
+
+func (f *fakeMetadataServiceClient) GetMetadataService(revision string) (*MetadataService, error) {
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[revision]++
+	svcs, ok := f.services[revision]
+	if !ok {
+		return nil, fmt.Errorf("no metadata for revision %q", revision)
+	}
+	return &MetadataService{Revision: revision, Services: svcs}, nil
+}
+
+func appRegistry(name string, metadata *fakeMetadataServiceClient, app *fakeApplicationRegistry) Registry {
+	return Registry{
+		ClusterID:        name,
+		RegistrationMode: RegistrationModeApplication,
+		App:              app,
+		Metadata:         metadata,
+	}
+}
+
+func TestResolveMetadataCachesByRevision(t *testing.T) {
+	c := NewController()
+	hostname := model.Hostname("svc.default.svc.cluster.local")
+	svc := &model.Service{Hostname: hostname, Ports: model.PortList{{Name: "http", Port: 80}}}
+	metadata := &fakeMetadataServiceClient{services: map[string][]*model.Service{"v1": {svc}}}
+	app := &fakeApplicationRegistry{app: &Application{Name: "reviews", Revision: "v1", Instances: []*AppInstance{
+		{App: "reviews", Revision: "v1", Address: "10.0.0.1"},
+	}}}
+	r := appRegistry("app-1", metadata, app)
+
+	if _, err := c.joinApplication(r); err != nil {
+		t.Fatalf("joinApplication() #1 error = %v", err)
+	}
+	if _, err := c.joinApplication(r); err != nil {
+		t.Fatalf("joinApplication() #2 error = %v", err)
+	}
+
+	if metadata.calls["v1"] != 1 {
+		t.Fatalf("GetMetadataService(v1) called %d times, want 1 (resolveMetadata should cache)", metadata.calls["v1"])
+	}
+	if app.calls != 2 {
+		t.Fatalf("GetApplication() called %d times, want 2 (one per joinApplication call)", app.calls)
+	}
+}
+
+func TestInvalidateMetadataDropsCacheForHostname(t *testing.T) {
+	c := NewController()
+	hostname := model.Hostname("svc.default.svc.cluster.local")
+	svc := &model.Service{Hostname: hostname, Ports: model.PortList{{Name: "http", Port: 80}}}
+	metadata := &fakeMetadataServiceClient{services: map[string][]*model.Service{"v1": {svc}}}
+	app := &fakeApplicationRegistry{app: &Application{Name: "reviews", Revision: "v1"}}
+	r := appRegistry("app-1", metadata, app)
+
+	if _, err := c.joinApplication(r); err != nil {
+		t.Fatalf("joinApplication() error = %v", err)
+	}
+	if metadata.calls["v1"] != 1 {
+		t.Fatalf("GetMetadataService(v1) called %d times, want 1", metadata.calls["v1"])
+	}
+
+	c.invalidateMetadata(hostname)
+
+	if _, err := c.joinApplication(r); err != nil {
+		t.Fatalf("joinApplication() after invalidate error = %v", err)
+	}
+	if metadata.calls["v1"] != 2 {
+		t.Fatalf("GetMetadataService(v1) called %d times after invalidate, want 2 (cache should have been dropped)", metadata.calls["v1"])
+	}
+}
+
+func TestInstancesFromApplicationJoinsAddressesAndPorts(t *testing.T) {
+	c := NewController()
+	hostname := model.Hostname("svc.default.svc.cluster.local")
+	svc := &model.Service{Hostname: hostname, Ports: model.PortList{
+		{Name: "http", Port: 80},
+		{Name: "grpc", Port: 9080},
+	}}
+	metadata := &fakeMetadataServiceClient{services: map[string][]*model.Service{"v1": {svc}}}
+	app := &fakeApplicationRegistry{app: &Application{
+		Name:     "reviews",
+		Revision: "v1",
+		Instances: []*AppInstance{
+			{App: "reviews", Revision: "v1", Address: "10.0.0.1", Labels: model.Labels{"version": "v1"}},
+			{App: "reviews", Revision: "v1", Address: "10.0.0.2", Labels: model.Labels{"version": "v1"}},
+		},
+	}}
+	r := appRegistry("app-1", metadata, app)
+
+	instances, err := c.instancesFromApplication(r, hostname, nil)
+	if err != nil {
+		t.Fatalf("instancesFromApplication() error = %v", err)
+	}
+	if len(instances) != 4 {
+		t.Fatalf("instancesFromApplication() returned %d instances, want 4 (2 addresses x 2 ports)", len(instances))
+	}
+
+	httpOnly, err := c.instancesByPortFromApplication(r, hostname, 80)
+	if err != nil {
+		t.Fatalf("instancesByPortFromApplication() error = %v", err)
+	}
+	if len(httpOnly) != 2 {
+		t.Fatalf("instancesByPortFromApplication(80) returned %d instances, want 2", len(httpOnly))
+	}
+	for _, inst := range httpOnly {
+		if inst.Endpoint.Port != 80 {
+			t.Errorf("instancesByPortFromApplication(80) returned endpoint port %d, want 80", inst.Endpoint.Port)
+		}
+	}
+}
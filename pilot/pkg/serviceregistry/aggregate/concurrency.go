@@ -0,0 +1,199 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/log"
+)
+
+// serviceCacheShards is the number of hostname-sharded locks used while merging the
+// concurrent per-registry results in Services().
+const serviceCacheShards = 32
+
+// versionMapShard is a single (mutex, map) bucket of a shardedVersionMap.
+type versionMapShard struct {
+	mu sync.Mutex
+	m  map[versionKey]*model.Service
+}
+
+// shardedVersionMap partitions a map[versionKey]*model.Service across serviceCacheShards
+// buckets, each owning its own mutex and its own map, so that merging results for hostnames
+// that hash into different shards can proceed without contending - or racing - on shared
+// state. A single shared map guarded by per-hostname locks is not enough: the locks only
+// serialize access to a given hostname's entry, but concurrent writes to *different* entries
+// of the same Go map are still a data race.
+type shardedVersionMap struct {
+	shards [serviceCacheShards]versionMapShard
+}
+
+func newShardedVersionMap() *shardedVersionMap {
+	sm := &shardedVersionMap{}
+	for i := range sm.shards {
+		sm.shards[i].m = make(map[versionKey]*model.Service)
+	}
+	return sm
+}
+
+func shardIndex(hostname model.Hostname) uint32 {
+	sum := fnv.New32a()
+	_, _ = sum.Write([]byte(hostname))
+	return sum.Sum32() % serviceCacheShards
+}
+
+// lock locks and returns the shard owning hostname; the caller must unlock shard.mu when done.
+func (sm *shardedVersionMap) lock(hostname model.Hostname) *versionMapShard {
+	shard := &sm.shards[shardIndex(hostname)]
+	shard.mu.Lock()
+	return shard
+}
+
+// bumpServiceCache invalidates the cached Services() result; the next caller rebuilds it.
+func (c *Controller) bumpServiceCache() {
+	atomic.AddUint64(&c.svcGen, 1)
+}
+
+// readServiceCache returns the cached Services() result for namespace ns if it's still
+// current. ns is the empty string for the unscoped (no ForNamespace) result.
+func (c *Controller) readServiceCache(ns string) ([]*model.Service, bool) {
+	c.svcCacheMu.RLock()
+	defer c.svcCacheMu.RUnlock()
+	if c.svcCacheGen != atomic.LoadUint64(&c.svcGen) {
+		return nil, false
+	}
+	svcs, ok := c.svcCache[ns]
+	return svcs, ok
+}
+
+// storeServiceCache records services as the ns result built under generation gen, unless the
+// cache has already been invalidated again since the build started.
+func (c *Controller) storeServiceCache(gen uint64, ns string, services []*model.Service) {
+	c.svcCacheMu.Lock()
+	defer c.svcCacheMu.Unlock()
+	if gen != atomic.LoadUint64(&c.svcGen) {
+		return
+	}
+	if c.svcCacheGen != gen {
+		c.svcCache = make(map[string][]*model.Service)
+		c.svcCacheGen = gen
+	}
+	c.svcCache[ns] = services
+}
+
+// servicesFromRegistry calls r.Services(), respecting r.Timeout if one is configured, so a
+// single slow registry can't block the rest of a Services() fan-out.
+func (c *Controller) servicesFromRegistry(r Registry) ([]*model.Service, error) {
+	if r.RegistrationMode == RegistrationModeApplication {
+		return c.joinApplication(r)
+	}
+	if r.Timeout <= 0 {
+		return r.Services()
+	}
+	type result struct {
+		svcs []*model.Service
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		svcs, err := r.Services()
+		ch <- result{svcs, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.svcs, res.err
+	case <-time.After(r.Timeout):
+		return nil, fmt.Errorf("registry %s timed out after %s fetching services", r.ClusterID, r.Timeout)
+	}
+}
+
+// instancesFromRegistry calls r.Instances(), respecting r.Timeout if one is configured.
+func (c *Controller) instancesFromRegistry(r Registry, hostname model.Hostname, ports []string,
+	labels model.LabelsCollection) ([]*model.ServiceInstance, error) {
+	if r.RegistrationMode == RegistrationModeApplication {
+		return c.instancesFromApplication(r, hostname, ports)
+	}
+	if r.Timeout <= 0 {
+		return r.Instances(hostname, ports, labels)
+	}
+	type result struct {
+		instances []*model.ServiceInstance
+		err       error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		instances, err := r.Instances(hostname, ports, labels)
+		ch <- result{instances, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.instances, res.err
+	case <-time.After(r.Timeout):
+		return nil, fmt.Errorf("registry %s timed out after %s fetching instances for %s", r.ClusterID, r.Timeout, hostname)
+	}
+}
+
+// instancesByPortFromRegistry calls r.InstancesByPort(), respecting r.Timeout if configured.
+func (c *Controller) instancesByPortFromRegistry(r Registry, hostname model.Hostname, port int,
+	labels model.LabelsCollection) ([]*model.ServiceInstance, error) {
+	if r.RegistrationMode == RegistrationModeApplication {
+		return c.instancesByPortFromApplication(r, hostname, port)
+	}
+	if r.Timeout <= 0 {
+		return r.InstancesByPort(hostname, port, labels)
+	}
+	type result struct {
+		instances []*model.ServiceInstance
+		err       error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		instances, err := r.InstancesByPort(hostname, port, labels)
+		ch <- result{instances, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.instances, res.err
+	case <-time.After(r.Timeout):
+		return nil, fmt.Errorf("registry %s timed out after %s fetching instances for %s:%d", r.ClusterID, r.Timeout, hostname, port)
+	}
+}
+
+// serviceAccountsFromRegistry calls r.GetIstioServiceAccounts(), respecting r.Timeout.
+func (c *Controller) serviceAccountsFromRegistry(r Registry, hostname model.Hostname, ports []string) []string {
+	if r.RegistrationMode == RegistrationModeApplication {
+		// Application-level registries don't publish service accounts.
+		return nil
+	}
+	if r.Timeout <= 0 {
+		return r.GetIstioServiceAccounts(hostname, ports)
+	}
+	ch := make(chan []string, 1)
+	go func() {
+		ch <- r.GetIstioServiceAccounts(hostname, ports)
+	}()
+	select {
+	case accounts := <-ch:
+		return accounts
+	case <-time.After(r.Timeout):
+		log.Warnf("registry %s timed out after %s fetching service accounts for %s", r.ClusterID, r.Timeout, hostname)
+		return nil
+	}
+}
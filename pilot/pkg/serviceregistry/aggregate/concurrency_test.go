@@ -0,0 +1,161 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// fakeDiscovery is a minimal model.ServiceDiscovery backing a Registry in tests; it reports a
+// fixed list of services, optionally after a delay, to exercise Registry.Timeout handling.
+type fakeDiscovery struct {
+	services []*model.Service
+	delay    time.Duration
+}
+
+func (f *fakeDiscovery) Services() ([]*model.Service, error) {
+	if f.delay > 0 {
+		time.Sleep(f.delay)
+	}
+	return f.services, nil
+}
+
+func (f *fakeDiscovery) GetService(model.Hostname) (*model.Service, error) { return nil, nil }
+func (f *fakeDiscovery) Instances(model.Hostname, []string, model.LabelsCollection) ([]*model.ServiceInstance, error) {
+	return nil, nil
+}
+func (f *fakeDiscovery) InstancesByPort(model.Hostname, int, model.LabelsCollection) ([]*model.ServiceInstance, error) {
+	return nil, nil
+}
+func (f *fakeDiscovery) GetProxyServiceInstances(*model.Proxy) ([]*model.ServiceInstance, error) {
+	return nil, nil
+}
+func (f *fakeDiscovery) ManagementPorts(string) model.PortList { return nil }
+
+func serviceFor(clusterID string) *model.Service {
+	return &model.Service{
+		Hostname: model.Hostname(fmt.Sprintf("svc.%s.svc.cluster.local", clusterID)),
+		Address:  "10.0.0.1",
+	}
+}
+
+// TestServicesFaultInjectionHangingRegistry verifies that a single registry which never
+// returns from Services() doesn't block the others: it should time out on its own
+// Registry.Timeout and surface as an error, while the rest of the merged result still comes
+// back promptly.
+func TestServicesFaultInjectionHangingRegistry(t *testing.T) {
+	c := NewController()
+	if err := c.AddRegistry(Registry{
+		ClusterID:        "healthy-1",
+		ServiceDiscovery: &fakeDiscovery{services: []*model.Service{serviceFor("healthy-1")}},
+	}); err != nil {
+		t.Fatalf("AddRegistry(healthy-1): %v", err)
+	}
+	if err := c.AddRegistry(Registry{
+		ClusterID:        "hangs",
+		Timeout:          20 * time.Millisecond,
+		ServiceDiscovery: &fakeDiscovery{services: []*model.Service{serviceFor("hangs")}, delay: time.Hour},
+	}); err != nil {
+		t.Fatalf("AddRegistry(hangs): %v", err)
+	}
+	if err := c.AddRegistry(Registry{
+		ClusterID:        "healthy-2",
+		ServiceDiscovery: &fakeDiscovery{services: []*model.Service{serviceFor("healthy-2")}},
+	}); err != nil {
+		t.Fatalf("AddRegistry(healthy-2): %v", err)
+	}
+
+	done := make(chan struct{})
+	var svcs []*model.Service
+	var err error
+	go func() {
+		svcs, err = c.Services()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Services() did not return within 2s of a registry hanging past its Timeout")
+	}
+
+	if err == nil {
+		t.Fatal("Services() error = nil, want an error reporting the hung registry's timeout")
+	}
+	if len(svcs) != 2 {
+		t.Fatalf("Services() returned %d services, want 2 from the healthy registries", len(svcs))
+	}
+}
+
+// TestServicesConcurrentMergeRace exercises the shardedVersionMap merge path under the race
+// detector: many registries reporting many distinct hostnames, merged concurrently, must not
+// trip a concurrent map read/write.
+func TestServicesConcurrentMergeRace(t *testing.T) {
+	c := NewController()
+	const numRegistries = 50
+	const hostnamesPerRegistry = 20
+	for i := 0; i < numRegistries; i++ {
+		clusterID := fmt.Sprintf("cluster-%d", i)
+		svcs := make([]*model.Service, 0, hostnamesPerRegistry)
+		for j := 0; j < hostnamesPerRegistry; j++ {
+			svcs = append(svcs, &model.Service{
+				Hostname: model.Hostname(fmt.Sprintf("svc-%d.ns.svc.cluster.local", j)),
+				Address:  fmt.Sprintf("10.0.%d.%d", i, j),
+			})
+		}
+		if err := c.AddRegistry(Registry{ClusterID: clusterID, ServiceDiscovery: &fakeDiscovery{services: svcs}}); err != nil {
+			t.Fatalf("AddRegistry(%s): %v", clusterID, err)
+		}
+	}
+
+	svcs, err := c.Services()
+	if err != nil {
+		t.Fatalf("Services() error = %v", err)
+	}
+	if len(svcs) != hostnamesPerRegistry {
+		t.Fatalf("Services() returned %d services, want %d distinct hostnames", len(svcs), hostnamesPerRegistry)
+	}
+}
+
+// BenchmarkServicesScaling measures how Services() scales with the number of registries being
+// fanned out to and merged, exercising the sharded concurrent merge path.
+func BenchmarkServicesScaling(b *testing.B) {
+	for _, n := range []int{1, 10, 50, 200} {
+		n := n
+		b.Run(fmt.Sprintf("registries=%d", n), func(b *testing.B) {
+			c := NewController()
+			for i := 0; i < n; i++ {
+				clusterID := fmt.Sprintf("cluster-%d", i)
+				if err := c.AddRegistry(Registry{
+					ClusterID:        clusterID,
+					ServiceDiscovery: &fakeDiscovery{services: []*model.Service{serviceFor(clusterID)}},
+				}); err != nil {
+					b.Fatalf("AddRegistry(%s): %v", clusterID, err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.bumpServiceCache()
+				if _, err := c.Services(); err != nil {
+					b.Fatalf("Services() error = %v", err)
+				}
+			}
+		})
+	}
+}
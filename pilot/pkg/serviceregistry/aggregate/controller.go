@@ -15,7 +15,10 @@
 package aggregate
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
 
@@ -28,37 +31,107 @@ import (
 type Registry struct {
 	Name      serviceregistry.ServiceRegistry
 	ClusterID string
+
+	// Namespace scopes this registry to a single tenant. A ScopedController obtained from
+	// Controller.ForNamespace only considers registries whose Namespace matches it exactly; a
+	// registry that leaves Namespace empty is invisible under any ForNamespace scope (it only
+	// serves the unscoped Controller itself). AddRegistry rejects a new registry that
+	// duplicates an existing (ClusterID, Namespace) pair.
+	Namespace string
+
+	// RegistrationMode indicates whether this registry publishes per-service (interface-level)
+	// metadata directly through ServiceDiscovery, or a single per-application record that must
+	// be resolved through App and Metadata. Defaults to RegistrationModeInterface.
+	RegistrationMode RegistrationMode
+	// App is consulted instead of ServiceDiscovery when RegistrationMode is
+	// RegistrationModeApplication.
+	App ApplicationRegistry
+	// Metadata resolves an application revision into service and port metadata when
+	// RegistrationMode is RegistrationModeApplication.
+	Metadata MetadataServiceClient
+
+	// Timeout bounds how long the aggregate Controller waits on a single call to this
+	// registry's Services/Instances/InstancesByPort/GetIstioServiceAccounts before treating it
+	// as failed, so one slow registry can't block the rest of a fan-out. Zero means no
+	// timeout, preserving the previous blocking behavior.
+	Timeout time.Duration
+
 	model.Controller
 	model.ServiceDiscovery
 	model.ServiceAccounts
 }
 
-var (
-	clusterAddressesMutex sync.Mutex
-)
-
 // Controller aggregates data across different registries and monitors for changes
 type Controller struct {
 	registries []Registry
 	storeLock  sync.RWMutex
+
+	// policy decides which registry wins when more than one has a view of the same hostname
+	// or address, and how conflicting data between them is merged.
+	policy MergePolicy
+
+	// appMu guards hostnameApp and metadataCache, which back the application-level
+	// registration mode (RegistrationModeApplication).
+	appMu sync.RWMutex
+	// hostnameApp maps a hostname to the "app@revision" currently serving it, so cache
+	// invalidation can find the right revision to drop.
+	hostnameApp map[model.Hostname]string
+	// metadataCache caches the joined MetadataService by revision, so that instances sharing
+	// a revision only trigger a single metadata fetch.
+	metadataCache map[string]*MetadataService
+
+	// versionMu guards versions, which backs ServicesByVersion.
+	versionMu sync.RWMutex
+	// versions maps hostname -> version -> the service a registry reported under that version.
+	versions map[model.Hostname]map[string]*model.Service
+
+	// svcGen is bumped whenever something that could change the result of Services() happens
+	// (a registry is added/removed, or a service handler fires), invalidating svcCache.
+	svcGen uint64
+	// svcCacheMu guards svcCache and svcCacheGen, which hold a copy-on-write snapshot of the
+	// last Services() result per namespace (the empty string keying the unscoped result).
+	svcCacheMu  sync.RWMutex
+	svcCache    map[string][]*model.Service
+	svcCacheGen uint64
 }
 
-// NewController creates a new Aggregate controller
-func NewController() *Controller {
+// NewController creates a new Aggregate controller. An optional MergePolicy may be supplied
+// to control how the aggregate chooses among registries that all have a view of the same
+// hostname or address; it defaults to FirstMatchPolicy, preserving prior behavior.
+func NewController(policy ...MergePolicy) *Controller {
+	p := MergePolicy(FirstMatchPolicy{})
+	if len(policy) > 0 {
+		p = policy[0]
+	}
 
 	return &Controller{
-		registries: []Registry{},
+		registries:    []Registry{},
+		policy:        p,
+		hostnameApp:   make(map[model.Hostname]string),
+		metadataCache: make(map[string]*MetadataService),
+		versions:      make(map[model.Hostname]map[string]*model.Service),
+		svcCache:      make(map[string][]*model.Service),
 	}
 }
 
-// AddRegistry adds registries into the aggregated controller
-func (c *Controller) AddRegistry(registry Registry) {
+// AddRegistry adds registries into the aggregated controller. It rejects a registry that
+// duplicates the (ClusterID, Namespace) pair of one already registered, since the aggregate
+// wouldn't be able to tell the two apart when scoping lookups to that namespace.
+func (c *Controller) AddRegistry(registry Registry) error {
 	c.storeLock.Lock()
 	defer c.storeLock.Unlock()
 
+	for _, existing := range c.registries {
+		if existing.ClusterID == registry.ClusterID && existing.Namespace == registry.Namespace {
+			return fmt.Errorf("registry for cluster %q namespace %q is already registered", registry.ClusterID, registry.Namespace)
+		}
+	}
+
 	registries := c.registries
 	registries = append(registries, registry)
 	c.registries = registries
+	c.bumpServiceCache()
+	return nil
 }
 
 // DeleteRegistry deletes specified registry from the aggregated controller
@@ -78,6 +151,9 @@ func (c *Controller) DeleteRegistry(clusterID string) {
 	registries := c.registries
 	registries = append(registries[:index], registries[index+1:]...)
 	c.registries = registries
+	c.bumpServiceCache()
+	c.resetVersions()
+	c.resetApplicationState()
 	log.Infof("Registry for the cluster %s has been deleted.", clusterID)
 }
 
@@ -99,98 +175,225 @@ func (c *Controller) GetRegistryIndex(clusterID string) (int, bool) {
 	return 0, false
 }
 
-// Services lists services from all platforms
+// versionKey identifies a service by hostname and version so that multi-version deployments
+// across registries don't collapse onto a single *model.Service in smap.
+type versionKey struct {
+	hostname model.Hostname
+	version  string
+}
+
+// registryKey uniquely identifies a registry among all currently registered ones. ClusterID
+// alone isn't enough: it's frequently left empty, and AddRegistry explicitly allows it to
+// repeat across different Namespaces, so keying a per-registry result map by ClusterID alone
+// lets one registry's answer silently overwrite another's. (ClusterID, Namespace) is the same
+// pair AddRegistry uses to detect duplicates, so it's always unique.
+type registryKey struct {
+	clusterID string
+	namespace string
+}
+
+func keyFor(r Registry) registryKey {
+	return registryKey{clusterID: r.ClusterID, namespace: r.Namespace}
+}
+
+// Services lists services from all platforms. The result is served from a copy-on-write cache
+// that's invalidated whenever a registry is added/removed or a service handler fires; on a
+// cache miss, registries are queried concurrently (each bounded by its own Registry.Timeout)
+// and merged under per-hostname sharded locks rather than one global mutex.
+//
+// Services has the ctx-less signature model.ServiceDiscovery requires, so *Controller keeps
+// satisfying it; to scope a call to a single tenant's registries, use ForNamespace instead of
+// calling Controller directly.
 func (c *Controller) Services() ([]*model.Service, error) {
-	// smap is a map of hostname (string) to service, used to identify services that
-	// are installed in multiple clusters.
-	smap := make(map[model.Hostname]*model.Service)
+	return c.services("")
+}
+
+func (c *Controller) services(ns string) ([]*model.Service, error) {
+	if cached, ok := c.readServiceCache(ns); ok {
+		return cached, nil
+	}
 
+	startGen := atomic.LoadUint64(&c.svcGen)
+	registries := filterByNamespace(ns, c.GetRegistries())
+
+	// smap is keyed by (hostname, version), used to identify services that are installed in
+	// multiple clusters, while still keeping distinct versions of the same hostname separate.
+	// It's partitioned into per-hostname-hash shards, each with its own mutex and its own map,
+	// so that merging results for hostnames in different shards never touches the same map.
+	smap := newShardedVersionMap()
+	// firstVersion tracks the version returned in the flat services list for each hostname, so
+	// that the list keeps exactly one entry per hostname for backward compatibility.
+	firstVersion := make(map[model.Hostname]string)
 	services := make([]*model.Service, 0)
+
+	var mergeMu sync.Mutex // guards firstVersion/services, which span all hostnames
+	var errsMu sync.Mutex
 	var errs error
-	// Locking Registries list while walking it to prevent inconsistent results
-	for _, r := range c.GetRegistries() {
-		svcs, err := r.Services()
-		if err != nil {
-			errs = multierror.Append(errs, err)
-			continue
-		}
-		// Race condition: multiple threads may call Services, and multiple services
-		// may modify one of the service's cluster ID
-		clusterAddressesMutex.Lock()
-		for _, s := range svcs {
-			sp, ok := smap[s.Hostname]
-			if !ok {
-				// First time we see a service. The result will have a single service per hostname
-				// The first cluster will be listed first, so the services in the primary cluster
-				// will be used for default settings. If a service appears in multiple clusters,
-				// the order is less clear.
-				sp = s
-				smap[s.Hostname] = sp
-				services = append(services, sp)
+	var wg sync.WaitGroup
+	for _, r := range registries {
+		wg.Add(1)
+		go func(r Registry) {
+			defer wg.Done()
+			svcs, err := c.servicesFromRegistry(r)
+			if err != nil {
+				errsMu.Lock()
+				errs = multierror.Append(errs, err)
+				errsMu.Unlock()
+				return
 			}
+			for _, s := range svcs {
+				shard := smap.lock(s.Hostname)
+				version := serviceVersion(r, s.Hostname)
+				vk := versionKey{hostname: s.Hostname, version: version}
+				sp, ok := shard.m[vk]
+				if !ok {
+					// First time we see this (hostname, version) pair. The flat result keeps
+					// a single service per hostname for backward compatibility; which version
+					// and cluster win it depends on goroutine scheduling, so ServicesByVersion
+					// is the reliable way to see every version.
+					sp = s
+					shard.m[vk] = sp
+				}
+				c.recordVersion(version, sp)
+
+				// If the registry has a cluster ID, keep track of the cluster and the local
+				// address inside the cluster.
+				// TODO: what is this used for ? Do we want to support multiple VIPs, or
+				// only use the 'primary' VIP ?
+				if r.ClusterID != "" {
+					if sp.Addresses == nil {
+						sp.Addresses = make(map[string]string)
+					}
+					if existing, ok := sp.Addresses[r.ClusterID]; ok && existing != s.Address {
+						action, cerr := c.policy.ResolveAddressConflict(s.Hostname, r.ClusterID, existing, s.Address)
+						if cerr != nil {
+							errsMu.Lock()
+							errs = multierror.Append(errs, cerr)
+							errsMu.Unlock()
+						}
+						if action == MergeOverride {
+							sp.Addresses[r.ClusterID] = s.Address
+						}
+					} else {
+						sp.Addresses[r.ClusterID] = s.Address
+					}
+				}
+				shard.mu.Unlock()
 
-			// If the registry has a cluster ID, keep track of the cluster and the
-			// local address inside the cluster.
-			// TODO: what is this used for ? Do we want to support multiple VIPs, or
-			// only use the 'primary' VIP ?
-			if r.ClusterID != "" {
-				if sp.Addresses == nil {
-					sp.Addresses = make(map[string]string)
+				mergeMu.Lock()
+				if _, seen := firstVersion[s.Hostname]; !seen {
+					firstVersion[s.Hostname] = version
+					services = append(services, sp)
 				}
-				sp.Addresses[r.ClusterID] = s.Address
-				smap[s.Hostname] = sp
+				mergeMu.Unlock()
 			}
-		}
-		clusterAddressesMutex.Unlock()
+		}(r)
 	}
+	wg.Wait()
+
+	c.storeServiceCache(startGen, ns, services)
 	return services, errs
 }
 
 // GetService retrieves a service by hostname if exists
 func (c *Controller) GetService(hostname model.Hostname) (*model.Service, error) {
+	return c.getService("", hostname)
+}
+
+func (c *Controller) getService(ns string, hostname model.Hostname) (*model.Service, error) {
+	var candidates []Registry
+	byRegistry := make(map[registryKey]*model.Service)
 	var errs error
-	for _, r := range c.GetRegistries() {
-		service, err := r.GetService(hostname)
+	for _, r := range filterByNamespace(ns, c.GetRegistries()) {
+		var service *model.Service
+		var err error
+		if r.RegistrationMode == RegistrationModeApplication {
+			service, err = c.getServiceFromApplication(r, hostname)
+		} else {
+			service, err = r.GetService(hostname)
+		}
 		if err != nil {
 			errs = multierror.Append(errs, err)
-		} else if service != nil {
-			if errs != nil {
-				log.Warnf("GetService() found match but encountered an error: %v", errs)
-			}
-			return service, nil
+			continue
 		}
-
+		if service == nil {
+			continue
+		}
+		candidates = append(candidates, r)
+		byRegistry[keyFor(r)] = service
+	}
+	winner, ok := c.policy.SelectRegistry(candidates)
+	if !ok {
+		return nil, errs
+	}
+	if errs != nil {
+		log.Warnf("GetService() found match but encountered an error: %v", errs)
 	}
-	return nil, errs
+	return byRegistry[keyFor(winner)], nil
 }
 
-// ManagementPorts retrieves set of health check ports by instance IP
-// Return on the first hit.
+// ManagementPorts retrieves set of health check ports by instance IP, selected across
+// registries that report one for addr according to the aggregate's MergePolicy.
 func (c *Controller) ManagementPorts(addr string) model.PortList {
-	for _, r := range c.GetRegistries() {
+	return c.managementPorts("", addr)
+}
+
+func (c *Controller) managementPorts(ns string, addr string) model.PortList {
+	var candidates []Registry
+	byRegistry := make(map[registryKey]model.PortList)
+	for _, r := range filterByNamespace(ns, c.GetRegistries()) {
+		if r.RegistrationMode == RegistrationModeApplication {
+			// Application-level registries don't publish per-address management ports.
+			continue
+		}
 		if portList := r.ManagementPorts(addr); portList != nil {
-			return portList
+			candidates = append(candidates, r)
+			byRegistry[keyFor(r)] = portList
 		}
 	}
-	return nil
+	winner, ok := c.policy.SelectRegistry(candidates)
+	if !ok {
+		return nil
+	}
+	return byRegistry[keyFor(winner)]
 }
 
-// Instances retrieves instances for a service and its ports that match
-// any of the supplied labels. All instances match an empty label list.
+// Instances retrieves instances for a service and its ports that match any of the supplied
+// labels. All instances match an empty label list. Registries are queried concurrently, each
+// bounded by its own Registry.Timeout, so one slow registry can't block the others.
 func (c *Controller) Instances(hostname model.Hostname, ports []string,
 	labels model.LabelsCollection) ([]*model.ServiceInstance, error) {
-	var instances, tmpInstances []*model.ServiceInstance
+	return c.instances("", hostname, ports, labels)
+}
+
+func (c *Controller) instances(ns string, hostname model.Hostname, ports []string,
+	labels model.LabelsCollection) ([]*model.ServiceInstance, error) {
+	registries := filterByNamespace(ns, c.GetRegistries())
+	results := make([][]*model.ServiceInstance, len(registries))
+	regErrs := make([]error, len(registries))
+
+	var wg sync.WaitGroup
+	for i, r := range registries {
+		wg.Add(1)
+		go func(i int, r Registry) {
+			defer wg.Done()
+			results[i], regErrs[i] = c.instancesFromRegistry(r, hostname, ports, labels)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var instances []*model.ServiceInstance
 	var errs error
-	for _, r := range c.GetRegistries() {
-		var err error
-		tmpInstances, err = r.Instances(hostname, ports, labels)
-		if err != nil {
-			errs = multierror.Append(errs, err)
-		} else if len(tmpInstances) > 0 {
+	for i := range registries {
+		if regErrs[i] != nil {
+			errs = multierror.Append(errs, regErrs[i])
+			continue
+		}
+		if len(results[i]) > 0 {
 			if errs != nil {
 				log.Warnf("Instances() found match but encountered an error: %v", errs)
 			}
-			instances = append(instances, tmpInstances...)
+			instances = append(instances, results[i]...)
 		}
 	}
 	if len(instances) > 0 {
@@ -199,55 +402,102 @@ func (c *Controller) Instances(hostname model.Hostname, ports []string,
 	return instances, errs
 }
 
-// InstancesByPort retrieves instances for a service on a given port that match
-// any of the supplied labels. All instances match an empty label list.
+// InstancesByPort retrieves instances for a service on a given port that match any of the
+// supplied labels. All instances match an empty label list.
+//
+// An optional version selector may be passed to restrict the result to instances of a single
+// version, as reported by each registry's VersionedRegistry; omitting it preserves the
+// existing behavior of returning instances across all versions. Matching registries are
+// queried concurrently, each bounded by its own Registry.Timeout, and the result is ordered
+// deterministically by endpoint address and port so callers (e.g. subset routing) can rely on
+// a stable ordering across registries.
 func (c *Controller) InstancesByPort(hostname model.Hostname, port int,
-	labels model.LabelsCollection) ([]*model.ServiceInstance, error) {
-	var instances, tmpInstances []*model.ServiceInstance
+	labels model.LabelsCollection, version ...string) ([]*model.ServiceInstance, error) {
+	return c.instancesByPort("", hostname, port, labels, version...)
+}
+
+func (c *Controller) instancesByPort(ns string, hostname model.Hostname, port int,
+	labels model.LabelsCollection, version ...string) ([]*model.ServiceInstance, error) {
+	var selector string
+	if len(version) > 0 {
+		selector = version[0]
+	}
+
+	registries := filterByNamespace(ns, c.GetRegistries())
+	results := make([][]*model.ServiceInstance, len(registries))
+	regErrs := make([]error, len(registries))
+
+	var wg sync.WaitGroup
+	for i, r := range registries {
+		if selector != "" && serviceVersion(r, hostname) != selector {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, r Registry) {
+			defer wg.Done()
+			results[i], regErrs[i] = c.instancesByPortFromRegistry(r, hostname, port, labels)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var instances []*model.ServiceInstance
 	var errs error
-	for _, r := range c.GetRegistries() {
-		var err error
-		tmpInstances, err = r.InstancesByPort(hostname, port, labels)
-		if err != nil {
-			errs = multierror.Append(errs, err)
-		} else if len(tmpInstances) > 0 {
+	for i := range registries {
+		if regErrs[i] != nil {
+			errs = multierror.Append(errs, regErrs[i])
+			continue
+		}
+		if len(results[i]) > 0 {
 			if errs != nil {
 				log.Warnf("Instances() found match but encountered an error: %v", errs)
 			}
-			instances = append(instances, tmpInstances...)
+			instances = append(instances, results[i]...)
 		}
 	}
 	if len(instances) > 0 {
 		errs = nil
 	}
+	sortInstances(instances)
 	return instances, errs
 }
 
 // GetProxyServiceInstances lists service instances co-located with a given proxy
 func (c *Controller) GetProxyServiceInstances(node *model.Proxy) ([]*model.ServiceInstance, error) {
-	out := make([]*model.ServiceInstance, 0)
+	return c.getProxyServiceInstances("", node)
+}
+
+func (c *Controller) getProxyServiceInstances(ns string, node *model.Proxy) ([]*model.ServiceInstance, error) {
+	// It doesn't make sense for a single proxy to be found in more than one registry, so the
+	// configured MergePolicy only has to pick which registry's (non-empty) answer to trust.
+	var candidates []Registry
+	byRegistry := make(map[registryKey][]*model.ServiceInstance)
 	var errs error
-	// It doesn't make sense for a single proxy to be found in more than one registry.
-	// TODO: if otherwise, warning or else what to do about it.
-	for _, r := range c.GetRegistries() {
+	for _, r := range filterByNamespace(ns, c.GetRegistries()) {
+		if r.RegistrationMode == RegistrationModeApplication {
+			errs = multierror.Append(errs, errApplicationModeUnsupported(r, "GetProxyServiceInstances"))
+			continue
+		}
 		instances, err := r.GetProxyServiceInstances(node)
 		if err != nil {
 			errs = multierror.Append(errs, err)
-		} else if len(instances) > 0 {
-			out = append(out, instances...)
-			node.ClusterID = r.ClusterID
-			break
+			continue
 		}
-	}
-
-	if len(out) > 0 {
-		if errs != nil {
-			log.Warnf("GetProxyServiceInstances() found match but encountered an error: %v", errs)
+		if len(instances) == 0 {
+			continue
 		}
-		return out, nil
+		candidates = append(candidates, r)
+		byRegistry[keyFor(r)] = instances
 	}
 
-	return out, errs
+	winner, ok := c.policy.SelectForProxy(node, candidates)
+	if !ok {
+		return make([]*model.ServiceInstance, 0), errs
+	}
+	if errs != nil {
+		log.Warnf("GetProxyServiceInstances() found match but encountered an error: %v", errs)
+	}
+	node.ClusterID = winner.ClusterID
+	return byRegistry[keyFor(winner)], nil
 }
 
 // Run starts all the controllers
@@ -261,10 +511,29 @@ func (c *Controller) Run(stop <-chan struct{}) {
 	log.Info("Registry Aggregator terminated")
 }
 
+// wrapServiceHandler wraps f with the cache invalidation every service handler attached to a
+// registry must perform - dropping the handler's hostname from the application-join cache and
+// bumping the Services() cache generation - so that AppendServiceHandler and Watch install
+// identical behavior instead of one of them drifting out of sync with the other.
+func (c *Controller) wrapServiceHandler(f func(*model.Service, model.Event)) func(*model.Service, model.Event) {
+	return func(s *model.Service, e model.Event) {
+		c.invalidateMetadata(s.Hostname)
+		c.bumpServiceCache()
+		f(s, e)
+	}
+}
+
 // AppendServiceHandler implements a service catalog operation
 func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) error {
 	for _, r := range c.GetRegistries() {
-		if err := r.AppendServiceHandler(f); err != nil {
+		if r.RegistrationMode == RegistrationModeApplication {
+			// Application-level registries don't go through ServiceDiscovery, so no handler is
+			// attached to them and no events are forwarded from them. Their joined cache is
+			// dropped by invalidateMetadata when another registry's handler fires for one of
+			// their hostnames, and by DeleteRegistry.
+			continue
+		}
+		if err := r.AppendServiceHandler(c.wrapServiceHandler(f)); err != nil {
 			log.Infof("Fail to append service handler to adapter %s", r.Name)
 			return err
 		}
@@ -275,6 +544,10 @@ func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) e
 // AppendInstanceHandler implements a service instance catalog operation
 func (c *Controller) AppendInstanceHandler(f func(*model.ServiceInstance, model.Event)) error {
 	for _, r := range c.GetRegistries() {
+		if r.RegistrationMode == RegistrationModeApplication {
+			// Application-level registries don't publish per-instance events.
+			continue
+		}
 		if err := r.AppendInstanceHandler(f); err != nil {
 			log.Infof("Fail to append instance handler to adapter %s", r.Name)
 			return err
@@ -285,10 +558,89 @@ func (c *Controller) AppendInstanceHandler(f func(*model.ServiceInstance, model.
 
 // GetIstioServiceAccounts implements model.ServiceAccounts operation
 func (c *Controller) GetIstioServiceAccounts(hostname model.Hostname, ports []string) []string {
-	for _, r := range c.GetRegistries() {
-		if svcAccounts := r.GetIstioServiceAccounts(hostname, ports); svcAccounts != nil {
-			return svcAccounts
+	return c.getIstioServiceAccounts("", hostname, ports)
+}
+
+func (c *Controller) getIstioServiceAccounts(ns string, hostname model.Hostname, ports []string) []string {
+	registries := filterByNamespace(ns, c.GetRegistries())
+	results := make([][]string, len(registries))
+
+	var wg sync.WaitGroup
+	for i, r := range registries {
+		wg.Add(1)
+		go func(i int, r Registry) {
+			defer wg.Done()
+			results[i] = c.serviceAccountsFromRegistry(r, hostname, ports)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var candidates []Registry
+	byRegistry := make(map[registryKey][]string)
+	for i, r := range registries {
+		if results[i] != nil {
+			candidates = append(candidates, r)
+			byRegistry[keyFor(r)] = results[i]
 		}
 	}
-	return nil
+	winner, ok := c.policy.SelectRegistry(candidates)
+	if !ok {
+		return nil
+	}
+	return byRegistry[keyFor(winner)]
+}
+
+// ForNamespace returns a ScopedController restricting every call to registries whose
+// Namespace matches ns, so a single aggregate Controller can safely serve multiple isolated
+// tenants without leaking service names between them. Unlike threading a context through
+// Controller's own methods, this leaves Controller's method signatures identical to the
+// ctx-less model.ServiceDiscovery/model.Controller/model.ServiceAccounts interfaces it must
+// keep satisfying.
+func (c *Controller) ForNamespace(ns string) *ScopedController {
+	return &ScopedController{c: c, namespace: ns}
+}
+
+// ScopedController is a per-tenant view onto a Controller, obtained via Controller.ForNamespace.
+type ScopedController struct {
+	c         *Controller
+	namespace string
+}
+
+// Services implements model.ServiceDiscovery, scoped to registries in s.namespace.
+func (s *ScopedController) Services() ([]*model.Service, error) {
+	return s.c.services(s.namespace)
+}
+
+// GetService implements model.ServiceDiscovery, scoped to registries in s.namespace.
+func (s *ScopedController) GetService(hostname model.Hostname) (*model.Service, error) {
+	return s.c.getService(s.namespace, hostname)
+}
+
+// ManagementPorts implements model.ServiceDiscovery, scoped to registries in s.namespace.
+func (s *ScopedController) ManagementPorts(addr string) model.PortList {
+	return s.c.managementPorts(s.namespace, addr)
+}
+
+// Instances implements model.ServiceDiscovery, scoped to registries in s.namespace.
+func (s *ScopedController) Instances(hostname model.Hostname, ports []string,
+	labels model.LabelsCollection) ([]*model.ServiceInstance, error) {
+	return s.c.instances(s.namespace, hostname, ports, labels)
+}
+
+// InstancesByPort implements model.ServiceDiscovery, scoped to registries in s.namespace.
+func (s *ScopedController) InstancesByPort(hostname model.Hostname, port int,
+	labels model.LabelsCollection, version ...string) ([]*model.ServiceInstance, error) {
+	return s.c.instancesByPort(s.namespace, hostname, port, labels, version...)
+}
+
+// GetProxyServiceInstances implements model.ServiceDiscovery, scoped to registries in
+// s.namespace.
+func (s *ScopedController) GetProxyServiceInstances(node *model.Proxy) ([]*model.ServiceInstance, error) {
+	return s.c.getProxyServiceInstances(s.namespace, node)
+}
+
+// GetIstioServiceAccounts implements model.ServiceAccounts, scoped to registries in
+// s.namespace.
+func (s *ScopedController) GetIstioServiceAccounts(hostname model.Hostname, ports []string) []string {
+	return s.c.getIstioServiceAccounts(s.namespace, hostname, ports)
 }
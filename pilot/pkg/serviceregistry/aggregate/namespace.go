@@ -0,0 +1,63 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/log"
+)
+
+// filterByNamespace returns the subset of registries visible to namespace ns. ns == ""
+// means "no tenant scoping" (Controller's own, unscoped view) and returns every registry
+// unchanged, preserving single-tenant behavior. Once ns is non-empty, matching is strict: a
+// registry must carry the exact same Namespace to be included - one with no Namespace set is
+// only ever visible through the unscoped view, never through any tenant's ForNamespace scope -
+// so that one tenant's lookup can never surface another tenant's (or an unmigrated registry's)
+// service names.
+func filterByNamespace(ns string, registries []Registry) []Registry {
+	if ns == "" {
+		return registries
+	}
+
+	filtered := make([]Registry, 0, len(registries))
+	for _, r := range registries {
+		if r.Namespace == ns {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// AppendServiceHandlerForNamespace is like Controller.AppendServiceHandler, but only forwards
+// events from registries whose Namespace equals ns exactly. For a non-empty ns, a registry
+// that left Namespace unset never forwards through this method, matching the strict matching
+// filterByNamespace applies to reads; for ns == "", only registries that left Namespace unset
+// forward, whereas filterByNamespace treats "" as every registry.
+func (c *Controller) AppendServiceHandlerForNamespace(ns string, f func(*model.Service, model.Event)) error {
+	for _, r := range c.GetRegistries() {
+		if r.Namespace != ns {
+			continue
+		}
+		if r.RegistrationMode == RegistrationModeApplication {
+			// As in AppendServiceHandler, application-level registries have no handler to attach.
+			continue
+		}
+		if err := r.AppendServiceHandler(c.wrapServiceHandler(f)); err != nil {
+			log.Infof("Fail to append service handler to adapter %s", r.Name)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"fmt"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// MergeAction describes how a MergePolicy wants a conflicting address reported by two
+// registries for the same hostname/cluster combined. This is currently the only kind of
+// conflict the aggregate resolves through policy; ManagementPorts and GetIstioServiceAccounts
+// still resolve purely through SelectRegistry (whichever registry wins takes its whole
+// answer), since neither reports per-cluster data that could meaningfully be unioned the way
+// Addresses can.
+type MergeAction int
+
+const (
+	// MergeOverride replaces the existing value with the incoming one.
+	MergeOverride MergeAction = iota
+	// MergeReject keeps the existing value; the caller surfaces the conflict as an error.
+	MergeReject
+)
+
+// MergePolicy governs how the aggregate Controller selects among registries that all have a
+// view of the same hostname or address, and how conflicting addresses reported by different
+// registries are combined. It replaces the previously hard-coded "first registry wins"
+// behavior in GetService, ManagementPorts, GetProxyServiceInstances and
+// GetIstioServiceAccounts.
+type MergePolicy interface {
+	// SelectRegistry picks which of candidates - registries that already produced a non-empty
+	// result, in registry order - should supply the answer for a hostname or address-keyed
+	// lookup such as GetService, ManagementPorts or GetIstioServiceAccounts. The winning
+	// registry's entire answer is used as-is; this is the only merge step ManagementPorts and
+	// GetIstioServiceAccounts go through.
+	SelectRegistry(candidates []Registry) (Registry, bool)
+
+	// SelectForProxy is like SelectRegistry, but used by GetProxyServiceInstances, which also
+	// has the requesting proxy available to base the decision on (e.g. locality).
+	SelectForProxy(proxy *model.Proxy, candidates []Registry) (Registry, bool)
+
+	// ResolveAddressConflict decides what to do when two registries report different
+	// addresses for the same hostname under the same cluster ID. This is the only place a
+	// MergePolicy is consulted below the registry-selection level; see Controller.Services.
+	ResolveAddressConflict(hostname model.Hostname, clusterID string, existing, incoming string) (MergeAction, error)
+}
+
+// FirstMatchPolicy is the traditional behavior: the first registry (in registration order)
+// that produced a result wins, and a newly reported address always overrides the old one.
+type FirstMatchPolicy struct{}
+
+// SelectRegistry implements MergePolicy.
+func (FirstMatchPolicy) SelectRegistry(candidates []Registry) (Registry, bool) {
+	if len(candidates) == 0 {
+		return Registry{}, false
+	}
+	return candidates[0], true
+}
+
+// SelectForProxy implements MergePolicy.
+func (p FirstMatchPolicy) SelectForProxy(_ *model.Proxy, candidates []Registry) (Registry, bool) {
+	return p.SelectRegistry(candidates)
+}
+
+// ResolveAddressConflict implements MergePolicy.
+func (FirstMatchPolicy) ResolveAddressConflict(_ model.Hostname, _ string, _, _ string) (MergeAction, error) {
+	return MergeOverride, nil
+}
+
+// PrimaryClusterPolicy prefers a designated cluster ID whenever it is among the candidates,
+// falling back to the first match otherwise.
+type PrimaryClusterPolicy struct {
+	// Primary is the cluster ID to prefer.
+	Primary string
+}
+
+// SelectRegistry implements MergePolicy.
+func (p PrimaryClusterPolicy) SelectRegistry(candidates []Registry) (Registry, bool) {
+	if len(candidates) == 0 {
+		return Registry{}, false
+	}
+	for _, r := range candidates {
+		if r.ClusterID == p.Primary {
+			return r, true
+		}
+	}
+	return candidates[0], true
+}
+
+// SelectForProxy implements MergePolicy.
+func (p PrimaryClusterPolicy) SelectForProxy(_ *model.Proxy, candidates []Registry) (Registry, bool) {
+	return p.SelectRegistry(candidates)
+}
+
+// ResolveAddressConflict implements MergePolicy. The primary cluster's address always wins;
+// a conflicting address reported by any other cluster is rejected.
+func (p PrimaryClusterPolicy) ResolveAddressConflict(hostname model.Hostname, clusterID string, existing, incoming string) (MergeAction, error) {
+	if clusterID == p.Primary {
+		return MergeOverride, nil
+	}
+	return MergeReject, fmt.Errorf("rejecting address %q for %s reported by non-primary cluster %s, keeping %q",
+		incoming, hostname, clusterID, existing)
+}
+
+// LocalityWeightedPolicy ranks registries by a per-cluster weight, and prefers a registry
+// whose cluster already matches the requesting proxy's cluster when one is known.
+type LocalityWeightedPolicy struct {
+	// Weights maps a cluster ID to a relative selection weight; a higher weight wins. Cluster
+	// IDs absent from the map default to weight 0.
+	Weights map[string]int
+}
+
+// SelectRegistry implements MergePolicy.
+func (p LocalityWeightedPolicy) SelectRegistry(candidates []Registry) (Registry, bool) {
+	if len(candidates) == 0 {
+		return Registry{}, false
+	}
+	return p.heaviest(candidates), true
+}
+
+// SelectForProxy implements MergePolicy. It prefers a registry local to the proxy's current
+// cluster before falling back to the heaviest-weighted candidate.
+func (p LocalityWeightedPolicy) SelectForProxy(proxy *model.Proxy, candidates []Registry) (Registry, bool) {
+	if len(candidates) == 0 {
+		return Registry{}, false
+	}
+	if proxy != nil && proxy.ClusterID != "" {
+		for _, r := range candidates {
+			if r.ClusterID == proxy.ClusterID {
+				return r, true
+			}
+		}
+	}
+	return p.heaviest(candidates), true
+}
+
+// ResolveAddressConflict implements MergePolicy. Weights are not consulted: both addresses
+// come from the same cluster ID, so a differing incoming address is rejected with an error.
+func (p LocalityWeightedPolicy) ResolveAddressConflict(_ model.Hostname, clusterID string, existing, incoming string) (MergeAction, error) {
+	// A single registry only ever reports one address for its own cluster ID, so a conflict
+	// here means two registries share a cluster ID; keep whichever was recorded first.
+	if existing == incoming {
+		return MergeOverride, nil
+	}
+	return MergeReject, fmt.Errorf("cluster %s reported conflicting addresses %q and %q", clusterID, existing, incoming)
+}
+
+func (p LocalityWeightedPolicy) heaviest(candidates []Registry) Registry {
+	best := candidates[0]
+	bestWeight := p.Weights[best.ClusterID]
+	for _, r := range candidates[1:] {
+		if w := p.Weights[r.ClusterID]; w > bestWeight {
+			best = r
+			bestWeight = w
+		}
+	}
+	return best
+}
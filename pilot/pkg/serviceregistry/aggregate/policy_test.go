@@ -0,0 +1,126 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func registries(clusterIDs ...string) []Registry {
+	regs := make([]Registry, 0, len(clusterIDs))
+	for _, id := range clusterIDs {
+		regs = append(regs, Registry{ClusterID: id})
+	}
+	return regs
+}
+
+func TestMergePolicySelectRegistry(t *testing.T) {
+	cases := []struct {
+		name       string
+		policy     MergePolicy
+		candidates []Registry
+		want       string
+		wantOK     bool
+	}{
+		{"first match, no candidates", FirstMatchPolicy{}, nil, "", false},
+		{"first match, picks first", FirstMatchPolicy{}, registries("c1", "c2"), "c1", true},
+		{"primary cluster present", PrimaryClusterPolicy{Primary: "c2"}, registries("c1", "c2", "c3"), "c2", true},
+		{"primary cluster absent falls back to first", PrimaryClusterPolicy{Primary: "c9"}, registries("c1", "c2"), "c1", true},
+		{
+			"locality weighted picks heaviest",
+			LocalityWeightedPolicy{Weights: map[string]int{"c1": 1, "c2": 5}},
+			registries("c1", "c2"),
+			"c2",
+			true,
+		},
+		{
+			"locality weighted defaults missing weight to zero",
+			LocalityWeightedPolicy{Weights: map[string]int{"c1": 1}},
+			registries("c1", "c2"),
+			"c1",
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := tc.policy.SelectRegistry(tc.candidates)
+			if ok != tc.wantOK {
+				t.Fatalf("SelectRegistry() ok = %v, want %v", ok, tc.wantOK)
+			}
+			if ok && got.ClusterID != tc.want {
+				t.Fatalf("SelectRegistry() = %q, want %q", got.ClusterID, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergePolicySelectForProxy(t *testing.T) {
+	cases := []struct {
+		name       string
+		policy     MergePolicy
+		proxy      *model.Proxy
+		candidates []Registry
+		want       string
+	}{
+		{"nil proxy falls back to heaviest", LocalityWeightedPolicy{Weights: map[string]int{"c1": 1, "c2": 2}}, nil, registries("c1", "c2"), "c2"},
+		{"proxy cluster preferred over weight", LocalityWeightedPolicy{Weights: map[string]int{"c1": 1, "c2": 2}}, &model.Proxy{ClusterID: "c1"}, registries("c1", "c2"), "c1"},
+		{"proxy cluster not among candidates falls back", LocalityWeightedPolicy{Weights: map[string]int{"c2": 2}}, &model.Proxy{ClusterID: "c9"}, registries("c1", "c2"), "c2"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := tc.policy.SelectForProxy(tc.proxy, tc.candidates)
+			if !ok {
+				t.Fatalf("SelectForProxy() ok = false, want true")
+			}
+			if got.ClusterID != tc.want {
+				t.Fatalf("SelectForProxy() = %q, want %q", got.ClusterID, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergePolicyResolveAddressConflict(t *testing.T) {
+	cases := []struct {
+		name       string
+		policy     MergePolicy
+		clusterID  string
+		existing   string
+		incoming   string
+		wantAction MergeAction
+		wantErr    bool
+	}{
+		{"first match always overrides", FirstMatchPolicy{}, "c1", "10.0.0.1", "10.0.0.2", MergeOverride, false},
+		{"primary cluster overrides", PrimaryClusterPolicy{Primary: "c1"}, "c1", "10.0.0.1", "10.0.0.2", MergeOverride, false},
+		{"non-primary cluster rejected", PrimaryClusterPolicy{Primary: "c1"}, "c2", "10.0.0.1", "10.0.0.2", MergeReject, true},
+		{"locality weighted same address", LocalityWeightedPolicy{}, "c1", "10.0.0.1", "10.0.0.1", MergeOverride, false},
+		{"locality weighted conflicting address", LocalityWeightedPolicy{}, "c1", "10.0.0.1", "10.0.0.2", MergeReject, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			action, err := tc.policy.ResolveAddressConflict("svc.default.svc.cluster.local", tc.clusterID, tc.existing, tc.incoming)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ResolveAddressConflict() err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if action != tc.wantAction {
+				t.Fatalf("ResolveAddressConflict() action = %v, want %v", action, tc.wantAction)
+			}
+		})
+	}
+}
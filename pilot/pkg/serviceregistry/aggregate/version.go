@@ -0,0 +1,94 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"sort"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// VersionDefault is the version used for services reported by registries that don't
+// implement VersionedRegistry, preserving today's single-version behavior.
+const VersionDefault = ""
+
+// VersionedRegistry is implemented by a registry's ServiceDiscovery when it can distinguish
+// multiple versions of the same hostname, e.g. canary and stable deployments of one service
+// living behind the same name. Registries that don't implement it are treated as always
+// reporting VersionDefault, so Services() behaves exactly as before for them.
+type VersionedRegistry interface {
+	ServiceVersion(hostname model.Hostname) string
+}
+
+// serviceVersion returns the version r reports for hostname, or VersionDefault if r doesn't
+// implement VersionedRegistry.
+func serviceVersion(r Registry, hostname model.Hostname) string {
+	if v, ok := r.ServiceDiscovery.(VersionedRegistry); ok {
+		return v.ServiceVersion(hostname)
+	}
+	return VersionDefault
+}
+
+// ServicesByVersion returns the services published for hostname, keyed by the version each
+// registry reported them under. Registries that don't distinguish versions are grouped under
+// VersionDefault.
+func (c *Controller) ServicesByVersion(hostname model.Hostname) map[string]*model.Service {
+	c.versionMu.RLock()
+	defer c.versionMu.RUnlock()
+
+	byVersion, ok := c.versions[hostname]
+	if !ok {
+		return nil
+	}
+	out := make(map[string]*model.Service, len(byVersion))
+	for version, svc := range byVersion {
+		out[version] = svc
+	}
+	return out
+}
+
+// recordVersion stores svc under (hostname, version) for ServicesByVersion, replacing
+// whatever was previously recorded for that pair.
+func (c *Controller) recordVersion(version string, svc *model.Service) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+
+	byVersion, ok := c.versions[svc.Hostname]
+	if !ok {
+		byVersion = make(map[string]*model.Service)
+		c.versions[svc.Hostname] = byVersion
+	}
+	byVersion[version] = svc
+}
+
+// resetVersions drops every cached (hostname, version) entry, so a deleted registry's
+// reported services don't linger in ServicesByVersion. Services() repopulates it on its next
+// cache miss.
+func (c *Controller) resetVersions() {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	c.versions = make(map[model.Hostname]map[string]*model.Service)
+}
+
+// sortInstances orders instances deterministically by endpoint address and port, so that
+// InstancesByPort returns a stable ordering across registries for subset routing to rely on.
+func sortInstances(instances []*model.ServiceInstance) {
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Endpoint.Address != instances[j].Endpoint.Address {
+			return instances[i].Endpoint.Address < instances[j].Endpoint.Address
+		}
+		return instances[i].Endpoint.Port < instances[j].Endpoint.Port
+	})
+}
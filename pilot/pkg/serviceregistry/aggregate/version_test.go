@@ -0,0 +1,103 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// versionedFakeDiscovery is a fakeDiscovery that also implements VersionedRegistry, reporting
+// a fixed version for every hostname.
+type versionedFakeDiscovery struct {
+	fakeDiscovery
+	version string
+}
+
+func (f *versionedFakeDiscovery) ServiceVersion(model.Hostname) string { return f.version }
+
+func TestServicesByVersionMultipleVersions(t *testing.T) {
+	c := NewController()
+	hostname := model.Hostname("svc.default.svc.cluster.local")
+	if err := c.AddRegistry(Registry{
+		ClusterID: "stable",
+		ServiceDiscovery: &versionedFakeDiscovery{
+			fakeDiscovery: fakeDiscovery{services: []*model.Service{{Hostname: hostname, Address: "10.0.0.1"}}},
+			version:       "stable",
+		},
+	}); err != nil {
+		t.Fatalf("AddRegistry(stable): %v", err)
+	}
+	if err := c.AddRegistry(Registry{
+		ClusterID: "canary",
+		ServiceDiscovery: &versionedFakeDiscovery{
+			fakeDiscovery: fakeDiscovery{services: []*model.Service{{Hostname: hostname, Address: "10.0.0.2"}}},
+			version:       "canary",
+		},
+	}); err != nil {
+		t.Fatalf("AddRegistry(canary): %v", err)
+	}
+	if err := c.AddRegistry(Registry{
+		ClusterID:        "unversioned",
+		ServiceDiscovery: &fakeDiscovery{services: []*model.Service{{Hostname: hostname, Address: "10.0.0.3"}}},
+	}); err != nil {
+		t.Fatalf("AddRegistry(unversioned): %v", err)
+	}
+
+	if _, err := c.Services(); err != nil {
+		t.Fatalf("Services() error = %v", err)
+	}
+
+	byVersion := c.ServicesByVersion(hostname)
+	if len(byVersion) != 3 {
+		t.Fatalf("ServicesByVersion() returned %d versions, want 3: %v", len(byVersion), byVersion)
+	}
+	if svc := byVersion["stable"]; svc == nil || svc.Address != "10.0.0.1" {
+		t.Errorf("ServicesByVersion()[stable] = %v, want address 10.0.0.1", svc)
+	}
+	if svc := byVersion["canary"]; svc == nil || svc.Address != "10.0.0.2" {
+		t.Errorf("ServicesByVersion()[canary] = %v, want address 10.0.0.2", svc)
+	}
+	if svc := byVersion[VersionDefault]; svc == nil || svc.Address != "10.0.0.3" {
+		t.Errorf("ServicesByVersion()[VersionDefault] = %v, want address 10.0.0.3", svc)
+	}
+}
+
+func TestDeleteRegistryPrunesVersions(t *testing.T) {
+	c := NewController()
+	hostname := model.Hostname("svc.default.svc.cluster.local")
+	if err := c.AddRegistry(Registry{
+		ClusterID: "stable",
+		ServiceDiscovery: &versionedFakeDiscovery{
+			fakeDiscovery: fakeDiscovery{services: []*model.Service{{Hostname: hostname, Address: "10.0.0.1"}}},
+			version:       "stable",
+		},
+	}); err != nil {
+		t.Fatalf("AddRegistry(stable): %v", err)
+	}
+	if _, err := c.Services(); err != nil {
+		t.Fatalf("Services() error = %v", err)
+	}
+	if byVersion := c.ServicesByVersion(hostname); len(byVersion) != 1 {
+		t.Fatalf("ServicesByVersion() before delete = %v, want 1 entry", byVersion)
+	}
+
+	c.DeleteRegistry("stable")
+
+	if byVersion := c.ServicesByVersion(hostname); len(byVersion) != 0 {
+		t.Fatalf("ServicesByVersion() after DeleteRegistry = %v, want no stale entries", byVersion)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregate
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/log"
+)
+
+// DefaultDebounce is the debounce window Watch uses when the caller doesn't supply one.
+const DefaultDebounce = 100 * time.Millisecond
+
+// EventKind is the kind of change an AggregateEvent represents.
+type EventKind int
+
+const (
+	// EventAdd means hostname was newly observed.
+	EventAdd EventKind = iota
+	// EventUpdate means hostname already existed and some registry changed its view of it.
+	EventUpdate
+	// EventDelete means a registry reported hostname deleted; other registries may still
+	// have it.
+	EventDelete
+)
+
+// AggregateEvent is a single, debounced, revision-tagged change to a hostname, coalesced
+// across however many per-registry service handler callbacks fired for it within the
+// debounce window.
+type AggregateEvent struct {
+	Hostname        model.Hostname
+	ChangedClusters []string
+	Revision        uint64
+	Kind            EventKind
+}
+
+// Watch returns a channel of AggregateEvent, giving callers a single serialized, debounced
+// view of service changes across every registry instead of racing across per-registry
+// AppendServiceHandler callbacks. Events for a given hostname are emitted only after no
+// further callback has fired for it for the debounce window (DefaultDebounce unless debounce
+// is supplied). The channel is closed when ctx is done.
+func (c *Controller) Watch(ctx context.Context, debounce ...time.Duration) <-chan AggregateEvent {
+	d := DefaultDebounce
+	if len(debounce) > 0 {
+		d = debounce[0]
+	}
+
+	ws := &watchState{
+		out:      make(chan AggregateEvent, 16),
+		debounce: d,
+		pending:  make(map[model.Hostname]*pendingChange),
+	}
+
+	for _, r := range c.GetRegistries() {
+		if r.RegistrationMode == RegistrationModeApplication {
+			// Application-level registries don't go through ServiceDiscovery, so there's no
+			// per-registry handler to attach, and Watch emits no events for them.
+			continue
+		}
+		clusterID := r.ClusterID
+		handler := c.wrapServiceHandler(func(s *model.Service, e model.Event) {
+			ws.record(clusterID, s, e)
+		})
+		if err := r.AppendServiceHandler(handler); err != nil {
+			log.Infof("Watch: failed to attach service handler to registry %s: %v", r.Name, err)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		ws.close()
+	}()
+
+	return ws.out
+}
+
+// watchState holds the debounce timers and output channel for a single Watch() call.
+type watchState struct {
+	mu       sync.Mutex
+	out      chan AggregateEvent
+	debounce time.Duration
+	revision uint64
+	pending  map[model.Hostname]*pendingChange
+	closed   bool
+}
+
+// pendingChange accumulates the clusters and kind seen for a hostname since its last flush.
+type pendingChange struct {
+	clusters map[string]struct{}
+	kind     EventKind
+	timer    *time.Timer
+}
+
+func (ws *watchState) record(clusterID string, s *model.Service, e model.Event) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return
+	}
+
+	pc, ok := ws.pending[s.Hostname]
+	if !ok {
+		pc = &pendingChange{clusters: make(map[string]struct{})}
+		ws.pending[s.Hostname] = pc
+	}
+	if clusterID != "" {
+		pc.clusters[clusterID] = struct{}{}
+	}
+	pc.kind = eventKind(e)
+
+	if pc.timer != nil {
+		pc.timer.Stop()
+	}
+	hostname := s.Hostname
+	pc.timer = time.AfterFunc(ws.debounce, func() {
+		ws.flush(hostname)
+	})
+}
+
+func (ws *watchState) flush(hostname model.Hostname) {
+	ws.mu.Lock()
+	pc, ok := ws.pending[hostname]
+	if !ok || ws.closed {
+		ws.mu.Unlock()
+		return
+	}
+	delete(ws.pending, hostname)
+	rev := atomic.AddUint64(&ws.revision, 1)
+	clusters := make([]string, 0, len(pc.clusters))
+	for cl := range pc.clusters {
+		clusters = append(clusters, cl)
+	}
+	kind := pc.kind
+	ws.mu.Unlock()
+
+	select {
+	case ws.out <- AggregateEvent{Hostname: hostname, ChangedClusters: clusters, Revision: rev, Kind: kind}:
+	default:
+		log.Warnf("Watch: dropping event for %s, consumer too slow", hostname)
+	}
+}
+
+func (ws *watchState) close() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return
+	}
+	ws.closed = true
+	for _, pc := range ws.pending {
+		pc.timer.Stop()
+	}
+	close(ws.out)
+}
+
+func eventKind(e model.Event) EventKind {
+	switch e {
+	case model.EventAdd:
+		return EventAdd
+	case model.EventDelete:
+		return EventDelete
+	default:
+		return EventUpdate
+	}
+}